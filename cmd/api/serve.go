@@ -1,6 +1,14 @@
 package main
 
-import smr "github.com/satisfactorymodding/smr-api"
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	smr "github.com/satisfactorymodding/smr-api"
+	"github.com/satisfactorymodding/smr-api/nodes"
+)
 
 // @title Satisfactory Mod Repo API
 // @version 1
@@ -12,5 +20,37 @@ import smr "github.com/satisfactorymodding/smr-api"
 // @host api.ficsit.app
 // @BasePath /v1
 func main() {
+	configureDownloadCoalescing()
 	smr.Serve()
 }
+
+// configureDownloadCoalescing applies DOWNLOAD_COALESCE_TTL_SECONDS and
+// DOWNLOAD_COALESCE_MAX_IN_FLIGHT overrides from the environment, and starts logging
+// coalescing stats, so the defaults in nodes/download_coalescer.go are actually
+// configurable and observable in production rather than dead exported knobs.
+func configureDownloadCoalescing() {
+	if raw := os.Getenv("DOWNLOAD_COALESCE_TTL_SECONDS"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Printf("ignoring invalid DOWNLOAD_COALESCE_TTL_SECONDS %q: %v", raw, err)
+		} else {
+			nodes.SetDownloadCoalesceTTL(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	if raw := os.Getenv("DOWNLOAD_COALESCE_MAX_IN_FLIGHT"); raw != "" {
+		max, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Printf("ignoring invalid DOWNLOAD_COALESCE_MAX_IN_FLIGHT %q: %v", raw, err)
+		} else {
+			nodes.SetMaxInFlightDownloads(max)
+		}
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			coalesced, unique := nodes.DownloadCoalesceStats()
+			log.Printf("download coalescing: %d coalesced hits, %d unique resolutions", coalesced, unique)
+		}
+	}()
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// cacheTags indexes dbCache keys by the tags they were stored under (e.g. "mod:<modID>",
+// "version:<versionID>", "versions:all"), so a mutation can evict every cache entry that
+// might now be stale without waiting for TTL expiry. keyTags is the reverse index, used to
+// prune a key out of every tag it was registered against once dbCache evicts it, so tags
+// for keys that are never explicitly invalidated don't accumulate forever.
+var (
+	cacheTags   = map[string]map[string]struct{}{}
+	keyTags     = map[string][]string{}
+	cacheTagsMu sync.Mutex
+)
+
+func init() {
+	dbCache.OnEvicted(forgetCachedKeyTags)
+}
+
+// setCached stores value in dbCache under key and registers key against each of tags.
+func setCached(key string, value interface{}, tags ...string) {
+	dbCache.Set(key, value, cache.DefaultExpiration)
+
+	if len(tags) == 0 {
+		return
+	}
+
+	cacheTagsMu.Lock()
+	defer cacheTagsMu.Unlock()
+
+	for _, tag := range tags {
+		keys, ok := cacheTags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			cacheTags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	keyTags[key] = tags
+}
+
+// invalidateTag evicts every dbCache entry registered against tag. forgetCachedKeyTags
+// does the bookkeeping cleanup once each eviction lands.
+func invalidateTag(tag string) {
+	cacheTagsMu.Lock()
+	keys := make([]string, 0, len(cacheTags[tag]))
+	for key := range cacheTags[tag] {
+		keys = append(keys, key)
+	}
+	cacheTagsMu.Unlock()
+
+	for _, key := range keys {
+		dbCache.Delete(key)
+	}
+}
+
+// forgetCachedKeyTags is registered as dbCache's eviction callback, so a key leaving dbCache
+// by TTL expiry, not just an explicit invalidateTag, also forgets its tag registrations.
+func forgetCachedKeyTags(key string, _ interface{}) {
+	cacheTagsMu.Lock()
+	defer cacheTagsMu.Unlock()
+
+	for _, tag := range keyTags[key] {
+		keys, ok := cacheTags[tag]
+		if !ok {
+			continue
+		}
+
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(cacheTags, tag)
+		}
+	}
+	delete(keyTags, key)
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInvalidateTagEvictsRegisteredKeys(t *testing.T) {
+	setCached("GetModVersions_mod-1_stale", []Version{{ID: "version-1", ModID: "mod-1"}}, "mod:mod-1", "versions:all")
+
+	if _, ok := dbCache.Get("GetModVersions_mod-1_stale"); !ok {
+		t.Fatal("expected cache entry to be present after setCached")
+	}
+
+	invalidateTag("mod:mod-1")
+
+	if _, ok := dbCache.Get("GetModVersions_mod-1_stale"); ok {
+		t.Fatal("expected cache entry to be evicted after invalidating its tag")
+	}
+}
+
+func TestInvalidateTagLeavesOtherTagsAlone(t *testing.T) {
+	setCached("GetModVersions_mod-1", []Version{{ID: "version-1", ModID: "mod-1"}}, "mod:mod-1")
+	setCached("GetModVersions_mod-2", []Version{{ID: "version-2", ModID: "mod-2"}}, "mod:mod-2")
+
+	invalidateTag("mod:mod-1")
+
+	if _, ok := dbCache.Get("GetModVersions_mod-1"); ok {
+		t.Fatal("expected mod-1 entry to be evicted")
+	}
+
+	if _, ok := dbCache.Get("GetModVersions_mod-2"); !ok {
+		t.Fatal("expected mod-2 entry to survive invalidating an unrelated tag")
+	}
+}
+
+func TestCreateVersionInvalidatesModVersionsCacheImmediately(t *testing.T) {
+	ctx := context.Background()
+	modID := "mod-create-invalidation-test"
+
+	before := GetModVersions(modID, 0, 10, "created_at", "desc", false, false, &ctx)
+	if len(before) != 0 {
+		t.Fatalf("expected no versions for %s before creation, got %d", modID, len(before))
+	}
+
+	version := &Version{ID: "version-create-invalidation-test", ModID: modID, Version: "1.0.0", Approved: true}
+	if err := CreateVersion(version, &ctx); err != nil {
+		t.Fatalf("CreateVersion failed: %v", err)
+	}
+
+	after := GetModVersions(modID, 0, 10, "created_at", "desc", false, false, &ctx)
+	if len(after) != 1 || after[0].ID != version.ID {
+		t.Fatalf("expected the newly created version to appear immediately in GetModVersions, got %v", after)
+	}
+}
@@ -4,15 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/satisfactorymodding/smr-api/models"
 	"github.com/satisfactorymodding/smr-api/util"
 
-	"github.com/patrickmn/go-cache"
+	"golang.org/x/mod/semver"
 )
 
+// ErrNoMatchingVersion is returned by ResolveModVersionQuery when no version of the mod
+// satisfies the given query.
+var ErrNoMatchingVersion = errors.New("no version matching query")
+
 func GetVersionsByID(versionIds []string, ctx *context.Context) []Version {
 	cacheKey := "GetVersionsById_" + strings.Join(versionIds, ":")
 	if versions, ok := dbCache.Get(cacheKey); ok {
@@ -26,68 +31,94 @@ func GetVersionsByID(versionIds []string, ctx *context.Context) []Version {
 		return nil
 	}
 
-	dbCache.Set(cacheKey, versions, cache.DefaultExpiration)
+	tags := make([]string, 0, len(versions)+1)
+	tags = append(tags, "versions:all")
+	for _, version := range versions {
+		tags = append(tags, "version:"+version.ID)
+	}
+
+	setCached(cacheKey, versions, tags...)
 
 	return versions
 }
 
-func GetModLatestVersions(modID string, unapproved bool, ctx *context.Context) *[]Version {
-	cacheKey := "GetModLatestVersions_" + modID + "_" + fmt.Sprint(unapproved)
+func GetModLatestVersions(modID string, unapproved bool, includeRetracted bool, ctx *context.Context) *[]Version {
+	cacheKey := "GetModLatestVersions_" + modID + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 	if versions, ok := dbCache.Get(cacheKey); ok {
 		return versions.(*[]Version)
 	}
 
 	var versions []Version
 
-	DBCtx(ctx).Select("distinct on (mod_id, stability) *").
+	query := DBCtx(ctx).Select("distinct on (mod_id, stability) *").
 		Where("mod_id = ?", modID).
-		Where("approved = ? AND denied = ?", !unapproved, false).
-		Order("mod_id, stability, created_at desc").
-		Find(&versions)
+		Where("approved = ? AND denied = ?", !unapproved, false)
+
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
 
-	dbCache.Set(cacheKey, &versions, cache.DefaultExpiration)
+	query.Order("mod_id, stability, created_at desc").Find(&versions)
+
+	setCached(cacheKey, &versions, "mod:"+modID, "versions:all")
 
 	return &versions
 }
 
-func GetModsLatestVersions(modIds []string, unapproved bool, ctx *context.Context) *[]Version {
-	cacheKey := "GetModsLatestVersions_" + strings.Join(modIds, ":") + "_" + fmt.Sprint(unapproved)
+func GetModsLatestVersions(modIds []string, unapproved bool, includeRetracted bool, ctx *context.Context) *[]Version {
+	cacheKey := "GetModsLatestVersions_" + strings.Join(modIds, ":") + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 	if versions, ok := dbCache.Get(cacheKey); ok {
 		return versions.(*[]Version)
 	}
 
 	var versions []Version
 
-	DBCtx(ctx).Select("distinct on (mod_id, stability) *").
+	query := DBCtx(ctx).Select("distinct on (mod_id, stability) *").
 		Where("mod_id in (?)", modIds).
-		Where("approved = ? AND denied = ?", !unapproved, false).
-		Order("mod_id, stability, created_at desc").
-		Find(&versions)
+		Where("approved = ? AND denied = ?", !unapproved, false)
+
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
+
+	query.Order("mod_id, stability, created_at desc").Find(&versions)
+
+	tags := make([]string, 0, len(modIds)+1)
+	tags = append(tags, "versions:all")
+	for _, modID := range modIds {
+		tags = append(tags, "mod:"+modID)
+	}
 
-	dbCache.Set(cacheKey, &versions, cache.DefaultExpiration)
+	setCached(cacheKey, &versions, tags...)
 
 	return &versions
 }
 
-func GetModVersions(modID string, limit int, offset int, orderBy string, order string, unapproved bool, ctx *context.Context) []Version {
-	cacheKey := "GetModVersions_" + modID + "_" + fmt.Sprint(limit) + "_" + fmt.Sprint(offset) + "_" + orderBy + "_" + order + "_" + fmt.Sprint(unapproved)
+func GetModVersions(modID string, limit int, offset int, orderBy string, order string, unapproved bool, includeRetracted bool, ctx *context.Context) []Version {
+	cacheKey := "GetModVersions_" + modID + "_" + fmt.Sprint(limit) + "_" + fmt.Sprint(offset) + "_" + orderBy + "_" + order + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 	if versions, ok := dbCache.Get(cacheKey); ok {
 		return versions.([]Version)
 	}
 
 	var versions []Version
-	DBCtx(ctx).Limit(limit).Offset(offset).Order(orderBy+" "+order).Where("approved = ? AND denied = ?", !unapproved, false).Find(&versions, "mod_id = ?", modID)
+	query := DBCtx(ctx).Limit(limit).Offset(offset).Order(orderBy+" "+order).Where("approved = ? AND denied = ?", !unapproved, false)
+
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
 
-	dbCache.Set(cacheKey, versions, cache.DefaultExpiration)
+	query.Find(&versions, "mod_id = ?", modID)
+
+	setCached(cacheKey, versions, "mod:"+modID)
 
 	return versions
 }
 
-func GetModVersionsNew(modID string, filter *models.VersionFilter, unapproved bool, ctx *context.Context) []Version {
+func GetModVersionsNew(modID string, filter *models.VersionFilter, unapproved bool, includeRetracted bool, ctx *context.Context) []Version {
 	hash, err := filter.Hash()
 	cacheKey := ""
 	if err == nil {
-		cacheKey = "GetModVersionsNew_" + modID + "_" + hash + "_" + fmt.Sprint(unapproved)
+		cacheKey = "GetModVersionsNew_" + modID + "_" + hash + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 		if versions, ok := dbCache.Get(cacheKey); ok {
 			return versions.([]Version)
 		}
@@ -102,10 +133,16 @@ func GetModVersionsNew(modID string, filter *models.VersionFilter, unapproved bo
 			Order(string(*filter.OrderBy) + " " + string(*filter.Order))
 	}
 
-	query.Where("approved = ? AND denied = ?", !unapproved, false).Find(&versions, "mod_id = ?", modID)
+	query = query.Where("approved = ? AND denied = ?", !unapproved, false)
+
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
+
+	query.Find(&versions, "mod_id = ?", modID)
 
 	if cacheKey != "" {
-		dbCache.Set(cacheKey, versions, cache.DefaultExpiration)
+		setCached(cacheKey, versions, "mod:"+modID)
 	}
 
 	return versions
@@ -124,7 +161,7 @@ func GetModVersion(modID string, versionID string, ctx *context.Context) *Versio
 		return nil
 	}
 
-	dbCache.Set(cacheKey, &version, cache.DefaultExpiration)
+	setCached(cacheKey, &version, "mod:"+modID, "version:"+version.ID)
 
 	return &version
 }
@@ -142,11 +179,211 @@ func GetModVersionByName(modID string, versionName string, ctx *context.Context)
 		return nil
 	}
 
-	dbCache.Set(cacheKey, &version, cache.DefaultExpiration)
+	setCached(cacheKey, &version, "mod:"+modID, "version:"+version.ID)
 
 	return &version
 }
 
+// ResolveModVersionQuery resolves a Go-modules-style version query to a single version of
+// modID. Supported queries are:
+//   - "latest": the newest approved, non-prerelease release, falling back to the newest
+//     release overall if none is tagged as a stable release
+//   - "patch": the newest version sharing current's major and minor version
+//   - "upgrade": latest, unless current is already newer
+//   - a semver prefix, e.g. "v1" or "v1.2": the newest version matching that prefix
+//   - a full semver, e.g. "v1.2.3": that exact version
+//   - a comparison query, e.g. ">=v1.2.3": the newest version satisfying it, preferring
+//     non-prereleases
+//
+// channel selects the stability track to resolve against ("release" when empty) and current
+// is the caller's currently installed version, required for "patch"; without it "upgrade"
+// resolves the same as "latest". Retracted
+// versions are skipped by default, same as the other listing queries; set includeRetracted to
+// opt in. A pinned full-semver query can still match an exact retracted version regardless of
+// includeRetracted. It returns ErrNoMatchingVersion if nothing satisfies the query.
+func ResolveModVersionQuery(modID string, query string, current string, channel string, unapproved bool, includeRetracted bool, ctx *context.Context) (*Version, error) {
+	if channel == "" {
+		channel = "release"
+	}
+
+	cacheKey := "ResolveModVersionQuery_" + modID + "_" + query + "_" + channel + "_" + current + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
+	if version, ok := dbCache.Get(cacheKey); ok {
+		if version == nil {
+			return nil, ErrNoMatchingVersion
+		}
+		return version.(*Version), nil
+	}
+
+	var versions []Version
+	DBCtx(ctx).
+		Where("mod_id = ?", modID).
+		Where("approved = ? AND denied = ?", !unapproved, false).
+		Where("stability = ?", channel).
+		Find(&versions)
+
+	resolved, err := resolveVersionQuery(versions, query, current, includeRetracted)
+	if err != nil {
+		setCached(cacheKey, nil, "mod:"+modID)
+		return nil, err
+	}
+
+	setCached(cacheKey, resolved, "mod:"+modID, "version:"+resolved.ID)
+
+	return resolved, nil
+}
+
+// versionSemver normalizes a version's name into the "vX.Y.Z" form expected by
+// golang.org/x/mod/semver.
+func versionSemver(version Version) string {
+	if strings.HasPrefix(version.Version, "v") {
+		return version.Version
+	}
+	return "v" + version.Version
+}
+
+func resolveVersionQuery(versions []Version, query string, current string, includeRetracted bool) (*Version, error) {
+	valid := make([]Version, 0, len(versions))
+	for _, version := range versions {
+		if semver.IsValid(versionSemver(version)) {
+			valid = append(valid, version)
+		}
+	}
+
+	sort.Slice(valid, func(i, j int) bool {
+		return semver.Compare(versionSemver(valid[i]), versionSemver(valid[j])) > 0
+	})
+
+	// Retracted versions are excluded the same way "go get" treats excluded modules: an
+	// explicit pinned query for the exact retracted version is always allowed, and
+	// includeRetracted additionally opts every other query form into considering them.
+	unretracted := valid
+	if !includeRetracted {
+		unretracted = filterVersions(valid, func(v Version) bool { return !v.Retracted })
+	}
+
+	switch {
+	case query == "latest":
+		return newestVersion(unretracted, true)
+	case query == "patch":
+		if current == "" {
+			return nil, ErrNoMatchingVersion
+		}
+		return newestMatching(unretracted, func(v Version) bool {
+			return semver.MajorMinor(versionSemver(v)) == semver.MajorMinor(normalizeSemver(current))
+		})
+	case query == "upgrade":
+		latest, err := newestVersion(unretracted, true)
+		if err != nil {
+			return nil, err
+		}
+		if current != "" && semver.Compare(normalizeSemver(current), versionSemver(*latest)) > 0 {
+			return newestMatching(valid, func(v Version) bool {
+				return versionSemver(v) == normalizeSemver(current)
+			})
+		}
+		return latest, nil
+	case len(query) > 0 && (strings.HasPrefix(query, "<") || strings.HasPrefix(query, ">")):
+		return resolveComparisonQuery(unretracted, query)
+	default:
+		return resolvePrefixOrExactQuery(valid, unretracted, query)
+	}
+}
+
+func resolveComparisonQuery(versions []Version, query string) (*Version, error) {
+	op := query
+	target := ""
+	for _, candidate := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(query, candidate) {
+			op = candidate
+			target = normalizeSemver(strings.TrimPrefix(query, candidate))
+			break
+		}
+	}
+
+	if target == "" || !semver.IsValid(target) {
+		return nil, ErrNoMatchingVersion
+	}
+
+	matches := func(v Version) bool {
+		cmp := semver.Compare(versionSemver(v), target)
+		switch op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		default:
+			return false
+		}
+	}
+
+	return newestVersion(filterVersions(versions, matches), true)
+}
+
+func resolvePrefixOrExactQuery(all []Version, unretracted []Version, query string) (*Version, error) {
+	normalized := normalizeSemver(query)
+
+	if semver.IsValid(normalized) && semver.Canonical(normalized) == normalized {
+		// A full semver is a pinned query: allow it to match a retracted version so an
+		// existing install can still resolve to it, with the reason attached to the result.
+		return newestMatching(all, func(v Version) bool {
+			return versionSemver(v) == normalized
+		})
+	}
+
+	return newestMatching(unretracted, func(v Version) bool {
+		// Match whole components only, so "v1" matches v1.x.y but not v10.0.0.
+		name := versionSemver(v)
+		return name == normalized || strings.HasPrefix(name, normalized+".")
+	})
+}
+
+func filterVersions(versions []Version, predicate func(Version) bool) []Version {
+	filtered := make([]Version, 0, len(versions))
+	for _, version := range versions {
+		if predicate(version) {
+			filtered = append(filtered, version)
+		}
+	}
+	return filtered
+}
+
+// newestVersion returns the newest entry in versions, preferring non-prereleases when
+// preferStable is set and at least one non-prerelease exists.
+func newestVersion(versions []Version, preferStable bool) (*Version, error) {
+	if preferStable {
+		if stable, err := newestMatching(versions, func(v Version) bool {
+			return semver.Prerelease(versionSemver(v)) == ""
+		}); err == nil {
+			return stable, nil
+		}
+	}
+
+	return newestMatching(versions, func(Version) bool { return true })
+}
+
+// newestMatching returns the newest version in versions (already sorted descending by
+// semver) satisfying predicate.
+func newestMatching(versions []Version, predicate func(Version) bool) (*Version, error) {
+	for i := range versions {
+		if predicate(versions[i]) {
+			v := versions[i]
+			return &v, nil
+		}
+	}
+	return nil, ErrNoMatchingVersion
+}
+
+func normalizeSemver(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
 func CreateVersion(version *Version, ctx *context.Context) error {
 	var versionCount int64
 	DBCtx(ctx).Model(Version{}).Where("mod_id = ? AND version = ?", version.ModID, version.Version).Count(&versionCount)
@@ -168,11 +405,55 @@ func CreateVersion(version *Version, ctx *context.Context) error {
 	version.ID = util.GenerateUniqueID()
 	DBCtx(ctx).Create(&version)
 
+	invalidateTag("mod:" + version.ModID)
+	invalidateTag("versions:all")
+
 	return nil
 }
 
 func IncrementVersionDownloads(version *Version, ctx *context.Context) {
 	DBCtx(ctx).Model(version).Update("downloads", version.Downloads+1)
+
+	invalidateTag("version:" + version.ID)
+	invalidateTag("mod:" + version.ModID)
+}
+
+// RetractVersion marks a version as retracted with the given reason, mirroring Go modules'
+// "retracted" directive. Retracted versions remain directly downloadable, but are skipped by
+// list-style queries and by unpinned semver query resolution unless explicitly included.
+func RetractVersion(version *Version, reason string, ctx *context.Context) error {
+	now := time.Now()
+
+	if err := DBCtx(ctx).Model(version).Updates(map[string]interface{}{
+		"retracted":         true,
+		"retraction_reason": reason,
+		"retracted_at":      &now,
+	}).Error; err != nil {
+		return err
+	}
+
+	invalidateTag("version:" + version.ID)
+	invalidateTag("mod:" + version.ModID)
+	invalidateTag("versions:all")
+
+	return nil
+}
+
+// UnretractVersion reverses RetractVersion.
+func UnretractVersion(version *Version, ctx *context.Context) error {
+	if err := DBCtx(ctx).Model(version).Updates(map[string]interface{}{
+		"retracted":         false,
+		"retraction_reason": "",
+		"retracted_at":      nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	invalidateTag("version:" + version.ID)
+	invalidateTag("mod:" + version.ModID)
+	invalidateTag("versions:all")
+
+	return nil
 }
 
 func GetVersion(versionID string, ctx *context.Context) *Version {
@@ -188,7 +469,7 @@ func GetVersion(versionID string, ctx *context.Context) *Version {
 		return nil
 	}
 
-	dbCache.Set(cacheKey, &version, cache.DefaultExpiration)
+	setCached(cacheKey, &version, "version:"+version.ID)
 
 	return &version
 }
@@ -205,11 +486,11 @@ func GetVersions(limit int, offset int, orderBy string, order string, search str
 	return versions
 }
 
-func GetVersionsNew(filter *models.VersionFilter, unapproved bool, ctx *context.Context) []Version {
+func GetVersionsNew(filter *models.VersionFilter, unapproved bool, includeRetracted bool, ctx *context.Context) []Version {
 	hash, err := filter.Hash()
 	cacheKey := ""
 	if err == nil {
-		cacheKey = "GetVersionsNew_" + hash + "_" + fmt.Sprint(unapproved)
+		cacheKey = "GetVersionsNew_" + hash + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 		if versions, ok := dbCache.Get(cacheKey); ok {
 			return versions.([]Version)
 		}
@@ -218,6 +499,10 @@ func GetVersionsNew(filter *models.VersionFilter, unapproved bool, ctx *context.
 	var versions []Version
 	query := DBCtx(ctx).Where("approved = ? AND denied = ?", !unapproved, false)
 
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
+
 	if filter != nil {
 		query = query.Limit(*filter.Limit).
 			Offset(*filter.Offset).
@@ -235,7 +520,7 @@ func GetVersionsNew(filter *models.VersionFilter, unapproved bool, ctx *context.
 	query.Find(&versions)
 
 	if cacheKey != "" {
-		dbCache.Set(cacheKey, versions, cache.DefaultExpiration)
+		setCached(cacheKey, versions, "versions:all")
 	}
 
 	return versions
@@ -253,11 +538,11 @@ func GetVersionCount(search string, unapproved bool, ctx *context.Context) int64
 	return versionCount
 }
 
-func GetVersionCountNew(filter *models.VersionFilter, unapproved bool, ctx *context.Context) int64 {
+func GetVersionCountNew(filter *models.VersionFilter, unapproved bool, includeRetracted bool, ctx *context.Context) int64 {
 	hash, err := filter.Hash()
 	cacheKey := ""
 	if err == nil {
-		cacheKey = "GetVersionCountNew_" + hash + "_" + fmt.Sprint(unapproved)
+		cacheKey = "GetVersionCountNew_" + hash + "_" + fmt.Sprint(unapproved) + "_" + fmt.Sprint(includeRetracted)
 		if versionCount, ok := dbCache.Get(cacheKey); ok {
 			return versionCount.(int64)
 		}
@@ -266,6 +551,10 @@ func GetVersionCountNew(filter *models.VersionFilter, unapproved bool, ctx *cont
 	var versionCount int64
 	query := DBCtx(ctx).Model(Version{}).Where("approved = ? AND denied = ?", !unapproved, false)
 
+	if !includeRetracted {
+		query = query.Where("retracted = ?", false)
+	}
+
 	if filter != nil {
 		if filter.Search != nil && *filter.Search != "" {
 			query = query.Where("to_tsvector(version) @@ to_tsquery(?)", strings.Replace(*filter.Search, " ", " & ", -1))
@@ -275,7 +564,7 @@ func GetVersionCountNew(filter *models.VersionFilter, unapproved bool, ctx *cont
 	query.Count(&versionCount)
 
 	if cacheKey != "" {
-		dbCache.Set(cacheKey, versionCount, cache.DefaultExpiration)
+		setCached(cacheKey, versionCount, "versions:all")
 	}
 
 	return versionCount
@@ -284,5 +573,27 @@ func GetVersionCountNew(filter *models.VersionFilter, unapproved bool, ctx *cont
 func GetVersionDependencies(versionID string, ctx *context.Context) []VersionDependency {
 	var versionDependencies []VersionDependency
 	DBCtx(ctx).Where("version_id = ?", versionID).Find(&versionDependencies)
+
+	for i := range versionDependencies {
+		versionDependencies[i].Retracted = dependencyResolvesToRetracted(versionDependencies[i], ctx)
+	}
+
 	return versionDependencies
 }
+
+// dependencyResolvesToRetracted reports whether the version a client would currently resolve
+// for this dependency (the newest version of its mod satisfying its semver condition) is
+// retracted, so ficsit-cli and co. can warn the user about it.
+func dependencyResolvesToRetracted(dependency VersionDependency, ctx *context.Context) bool {
+	var versions []Version
+	DBCtx(ctx).Where("mod_id = ? AND approved = ? AND denied = ?", dependency.ModID, true, false).Find(&versions)
+
+	// includeRetracted so a dependency that now only resolves to a retracted version is
+	// still found, and its Retracted marker reported, instead of silently excluded.
+	resolved, err := resolveVersionQuery(versions, dependency.Condition, "", true)
+	if err != nil {
+		return false
+	}
+
+	return resolved.Retracted
+}
@@ -0,0 +1,202 @@
+package postgres
+
+import "testing"
+
+func mkVersion(id, version string, retracted bool) Version {
+	return Version{ID: id, Version: version, Retracted: retracted}
+}
+
+func TestResolveVersionQueryLatest(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.2.0", false),
+		mkVersion("v3", "1.1.0", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "latest", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected v2 to be latest, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryLatestPrefersStableOverPrerelease(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.1.0-beta.1", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "latest", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v1" {
+		t.Fatalf("expected the stable release to win over a newer prerelease, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryLatestSkipsRetractedByDefault(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.1.0", true),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "latest", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v1" {
+		t.Fatalf("expected the retracted v2 to be skipped, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryLatestIncludesRetractedWhenRequested(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.1.0", true),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "latest", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected includeRetracted to allow the retracted v2 to win, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryPatchRequiresCurrent(t *testing.T) {
+	versions := []Version{mkVersion("v1", "1.0.0", false)}
+
+	if _, err := resolveVersionQuery(versions, "patch", "", false); err != ErrNoMatchingVersion {
+		t.Fatalf("expected ErrNoMatchingVersion without a current version, got %v", err)
+	}
+}
+
+func TestResolveVersionQueryPatchStaysOnMajorMinor(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.0.5", false),
+		mkVersion("v3", "1.1.0", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "patch", "1.0.0", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected patch query to stay on 1.0.x, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryUpgradeKeepsNewerInstalledVersion(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.1.0", false),
+		mkVersion("v3", "2.0.0", true),
+	}
+
+	// The currently installed version is a retracted release newer than anything the
+	// unpinned "upgrade" query would otherwise consider; it should be kept rather than
+	// downgraded to the newest unretracted version.
+	resolved, err := resolveVersionQuery(versions, "upgrade", "2.0.0", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v3" {
+		t.Fatalf("expected upgrade to keep the already-installed newer version, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryComparison(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.5.0", false),
+		mkVersion("v3", "2.0.0", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "<2.0.0", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected <2.0.0 to resolve to the newest match below it, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryComparisonInvalidTarget(t *testing.T) {
+	versions := []Version{mkVersion("v1", "1.0.0", false)}
+
+	if _, err := resolveVersionQuery(versions, "<not-a-version", "", false); err != ErrNoMatchingVersion {
+		t.Fatalf("expected ErrNoMatchingVersion for an invalid comparison target, got %v", err)
+	}
+}
+
+func TestResolveVersionQueryPrefix(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.0.5", false),
+		mkVersion("v3", "1.1.0", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "1.0", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected the 1.0 prefix query to resolve to the newest 1.0.x, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryExactPinAllowsRetracted(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.1.0", true),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "1.1.0", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v2" {
+		t.Fatalf("expected a pinned exact query to still resolve to a retracted version, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryPrefixSkipsRetracted(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "1.0.5", true),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "1.0", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v1" {
+		t.Fatalf("expected the retracted 1.0.5 to be skipped by the unpinned prefix query, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryIgnoresInvalidSemver(t *testing.T) {
+	versions := []Version{
+		mkVersion("v1", "1.0.0", false),
+		mkVersion("v2", "not-a-version", false),
+	}
+
+	resolved, err := resolveVersionQuery(versions, "latest", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ID != "v1" {
+		t.Fatalf("expected the invalid semver entry to be ignored, got %s", resolved.ID)
+	}
+}
+
+func TestResolveVersionQueryNoMatch(t *testing.T) {
+	if _, err := resolveVersionQuery(nil, "latest", "", false); err != ErrNoMatchingVersion {
+		t.Fatalf("expected ErrNoMatchingVersion for an empty version list, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/satisfactorymodding/smr-api/db/postgres"
+)
+
+// ResolveModVersion is the resolver for the resolveModVersion field.
+func (r *queryResolver) ResolveModVersion(ctx context.Context, modID string, query *string, current *string, channel *string, includeRetracted *bool) (*postgres.Version, error) {
+	resolvedQuery := "latest"
+	if query != nil {
+		resolvedQuery = *query
+	}
+
+	resolvedCurrent := ""
+	if current != nil {
+		resolvedCurrent = *current
+	}
+
+	resolvedChannel := ""
+	if channel != nil {
+		resolvedChannel = *channel
+	}
+
+	resolvedIncludeRetracted := includeRetracted != nil && *includeRetracted
+
+	version, err := postgres.ResolveModVersionQuery(modID, resolvedQuery, resolvedCurrent, resolvedChannel, false, resolvedIncludeRetracted, &ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// RetractVersion is the resolver for the retractVersion field.
+func (r *mutationResolver) RetractVersion(ctx context.Context, versionID string, reason string) (*postgres.Version, error) {
+	version := postgres.GetVersion(versionID, &ctx)
+	if version == nil {
+		return nil, errors.New("version not found")
+	}
+
+	if err := postgres.RetractVersion(version, reason, &ctx); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// UnretractVersion is the resolver for the unretractVersion field.
+func (r *mutationResolver) UnretractVersion(ctx context.Context, versionID string) (*postgres.Version, error) {
+	version := postgres.GetVersion(versionID, &ctx)
+	if version == nil {
+		return nil, errors.New("version not found")
+	}
+
+	if err := postgres.UnretractVersion(version, &ctx); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
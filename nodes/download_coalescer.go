@@ -0,0 +1,99 @@
+package nodes
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/satisfactorymodding/smr-api/db/postgres"
+	"github.com/satisfactorymodding/smr-api/storage"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// downloadResolution caches a signed download URL for a version so that concurrent
+// requests for the same version share a single storage round-trip.
+type downloadResolution struct {
+	url     string
+	created time.Time
+	ready   chan struct{}
+}
+
+var (
+	// downloadGroup coalesces concurrent GenerateDownloadLink calls for the same version,
+	// mirroring the downloadGroup pattern used by ficsit-cli's DownloadOrCache.
+	downloadGroup = xsync.NewMapOf[string, *downloadResolution]()
+
+	// downloadLinkTTL bounds how long a resolved URL is shared before later requests
+	// re-resolve it; it should track the signed URL's own lifetime.
+	downloadLinkTTL = 5 * time.Minute
+
+	// maxInFlightDownloads bounds how many versions can have a cached or in-flight
+	// resolution at once, to cap memory during a release burst.
+	maxInFlightDownloads = 10000
+
+	downloadCoalescedHits     uint64
+	downloadUniqueResolutions uint64
+)
+
+// downloadLinkGenerator is storage.GenerateDownloadLink by default; tests swap it out so
+// coalescing behavior can be verified without hitting real storage.
+var downloadLinkGenerator = storage.GenerateDownloadLink
+
+// SetDownloadCoalesceTTL overrides how long a resolved download URL is shared between
+// concurrent requests for the same version.
+func SetDownloadCoalesceTTL(ttl time.Duration) {
+	downloadLinkTTL = ttl
+}
+
+// SetMaxInFlightDownloads bounds how many versions can have an in-flight or cached
+// resolution at once.
+func SetMaxInFlightDownloads(max int) {
+	maxInFlightDownloads = max
+}
+
+// DownloadCoalesceStats reports coalesced hits vs. unique resolutions, for metrics scraping.
+func DownloadCoalesceStats() (coalesced uint64, unique uint64) {
+	return atomic.LoadUint64(&downloadCoalescedHits), atomic.LoadUint64(&downloadUniqueResolutions)
+}
+
+// resolveDownloadURL returns the signed download URL for version, coalescing concurrent
+// calls for the same version ID into a single GenerateDownloadLink call.
+func resolveDownloadURL(version *postgres.Version) string {
+	if existing, ok := downloadGroup.Load(version.ID); ok && time.Since(existing.created) < downloadLinkTTL {
+		<-existing.ready
+		atomic.AddUint64(&downloadCoalescedHits, 1)
+		return existing.url
+	}
+
+	if downloadGroup.Size() >= maxInFlightDownloads {
+		atomic.AddUint64(&downloadUniqueResolutions, 1)
+		return downloadLinkGenerator(version.Key)
+	}
+
+	resolution := &downloadResolution{created: time.Now(), ready: make(chan struct{})}
+
+	actual, loaded := downloadGroup.LoadOrStore(version.ID, resolution)
+	if loaded {
+		if time.Since(actual.created) < downloadLinkTTL {
+			<-actual.ready
+			atomic.AddUint64(&downloadCoalescedHits, 1)
+			return actual.url
+		}
+
+		// The stored entry is stale; replace it and resolve ourselves.
+		downloadGroup.Store(version.ID, resolution)
+	}
+
+	atomic.AddUint64(&downloadUniqueResolutions, 1)
+
+	resolution.url = downloadLinkGenerator(version.Key)
+	close(resolution.ready)
+
+	time.AfterFunc(downloadLinkTTL, func() {
+		if current, ok := downloadGroup.Load(version.ID); ok && current == resolution {
+			downloadGroup.Delete(version.ID)
+		}
+	})
+
+	return resolution.url
+}
@@ -0,0 +1,130 @@
+package nodes
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satisfactorymodding/smr-api/db/postgres"
+)
+
+// resetDownloadCoalescer clears downloadGroup and restores the package defaults so tests
+// don't leak state into one another.
+func resetDownloadCoalescer(t *testing.T) {
+	t.Helper()
+
+	var keys []string
+	downloadGroup.Range(func(key string, _ *downloadResolution) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		downloadGroup.Delete(key)
+	}
+
+	previousTTL := downloadLinkTTL
+	previousMax := maxInFlightDownloads
+	previousGenerator := downloadLinkGenerator
+	atomic.StoreUint64(&downloadCoalescedHits, 0)
+	atomic.StoreUint64(&downloadUniqueResolutions, 0)
+
+	t.Cleanup(func() {
+		downloadLinkTTL = previousTTL
+		maxInFlightDownloads = previousMax
+		downloadLinkGenerator = previousGenerator
+	})
+}
+
+func TestResolveDownloadURLCoalescesConcurrentCalls(t *testing.T) {
+	resetDownloadCoalescer(t)
+
+	var calls uint64
+	downloadLinkGenerator = func(key string) string {
+		atomic.AddUint64(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "https://example.com/" + key
+	}
+
+	version := &postgres.Version{ID: "version-1", Key: "key-1"}
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	results := make([]string, goroutines)
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			results[i] = resolveDownloadURL(version)
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadUint64(&calls); got != 1 {
+		t.Fatalf("expected exactly one underlying generator call, got %d", got)
+	}
+
+	for i, result := range results {
+		if result != "https://example.com/key-1" {
+			t.Fatalf("result %d: expected the coalesced URL, got %q", i, result)
+		}
+	}
+
+	coalesced, unique := DownloadCoalesceStats()
+	if unique != 1 || coalesced != goroutines-1 {
+		t.Fatalf("expected 1 unique and %d coalesced, got unique=%d coalesced=%d", goroutines-1, unique, coalesced)
+	}
+}
+
+func TestResolveDownloadURLReResolvesAfterTTL(t *testing.T) {
+	resetDownloadCoalescer(t)
+
+	var calls uint64
+	downloadLinkGenerator = func(key string) string {
+		n := atomic.AddUint64(&calls, 1)
+		return "https://example.com/" + key + "/" + strconv.FormatUint(n, 10)
+	}
+
+	SetDownloadCoalesceTTL(time.Millisecond)
+
+	version := &postgres.Version{ID: "version-2", Key: "key-2"}
+
+	first := resolveDownloadURL(version)
+
+	time.Sleep(5 * time.Millisecond)
+
+	second := resolveDownloadURL(version)
+
+	if first == second {
+		t.Fatal("expected a fresh URL to be resolved once the TTL elapsed")
+	}
+	if got := atomic.LoadUint64(&calls); got != 2 {
+		t.Fatalf("expected the generator to run twice across the TTL boundary, got %d", got)
+	}
+}
+
+func TestResolveDownloadURLSkipsCoalescingAtMaxInFlight(t *testing.T) {
+	resetDownloadCoalescer(t)
+
+	var calls uint64
+	downloadLinkGenerator = func(key string) string {
+		atomic.AddUint64(&calls, 1)
+		return "https://example.com/" + key
+	}
+
+	SetMaxInFlightDownloads(0)
+
+	version := &postgres.Version{ID: "version-3", Key: "key-3"}
+
+	resolveDownloadURL(version)
+	resolveDownloadURL(version)
+
+	if got := atomic.LoadUint64(&calls); got != 2 {
+		t.Fatalf("expected every call to bypass coalescing once at the cap, got %d generator calls", got)
+	}
+	if _, ok := downloadGroup.Load(version.ID); ok {
+		t.Fatal("expected no resolution to be tracked once the in-flight cap is reached")
+	}
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/satisfactorymodding/smr-api/db/postgres"
 	"github.com/satisfactorymodding/smr-api/redis"
-	"github.com/satisfactorymodding/smr-api/storage"
 	"github.com/satisfactorymodding/smr-api/util"
 
 	"github.com/labstack/echo/v4"
@@ -31,6 +30,98 @@ func getVersion(c echo.Context) (interface{}, *ErrorResponse) {
 	return VersionToVersion(version), nil
 }
 
+// @Summary Resolve a Mod Version
+// @Tags Version
+// @Description Resolve the best matching version for a mod from a Go-modules-style version query (latest, patch, upgrade, a semver prefix, a full semver or a comparison query)
+// @Accept  json
+// @Produce  json
+// @Param modId path string true "Mod ID"
+// @Param query query string false "Version query, defaults to latest" default(latest)
+// @Param current query string false "Currently installed version, required for patch queries; without it upgrade resolves like latest"
+// @Param channel query string false "Stability channel to resolve against" default(release)
+// @Param includeRetracted query bool false "Allow unpinned queries to resolve to a retracted version" default(false)
+// @Success 200
+// @Router /mod/{modId}/versions/resolve [get]
+func resolveModVersion(c echo.Context) (interface{}, *ErrorResponse) {
+	modID := c.Param("modId")
+
+	query := c.QueryParam("query")
+	if query == "" {
+		query = "latest"
+	}
+
+	includeRetracted := c.QueryParam("includeRetracted") == "true"
+
+	version, err := postgres.ResolveModVersionQuery(modID, query, c.QueryParam("current"), c.QueryParam("channel"), false, includeRetracted, util.Context(c))
+	if err != nil {
+		return nil, &ErrorVersionNotFound
+	}
+
+	return VersionToVersion(version), nil
+}
+
+type retractVersionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ErrorInvalidRetractionBody is returned when the retract request body can't be parsed,
+// distinct from ErrorVersionNotFound so clients can tell a bad request from a missing version.
+var ErrorInvalidRetractionBody = ErrorResponse{Error: "invalid request body"}
+
+// @Summary Retract a Version
+// @Tags Version
+// @Description Mark a version as retracted, with a reason. Unlike denial, the file remains
+// directly downloadable; the version is only skipped by listings and unpinned semver query
+// resolution.
+// @Accept  json
+// @Produce  json
+// @Param versionId path string true "Version ID"
+// @Param version body retractVersionRequest true "Retraction reason"
+// @Success 200
+// @Router /admin/versions/{versionId}/retract [post]
+func retractVersion(c echo.Context) (interface{}, *ErrorResponse) {
+	versionID := c.Param("versionId")
+
+	version := postgres.GetVersion(versionID, util.Context(c))
+	if version == nil {
+		return nil, &ErrorVersionNotFound
+	}
+
+	var body retractVersionRequest
+	if err := c.Bind(&body); err != nil {
+		return nil, &ErrorInvalidRetractionBody
+	}
+
+	if err := postgres.RetractVersion(version, body.Reason, util.Context(c)); err != nil {
+		return nil, &ErrorVersionNotFound
+	}
+
+	return VersionToVersion(version), nil
+}
+
+// @Summary Un-retract a Version
+// @Tags Version
+// @Description Reverse a previous retraction of a version
+// @Accept  json
+// @Produce  json
+// @Param versionId path string true "Version ID"
+// @Success 200
+// @Router /admin/versions/{versionId}/unretract [post]
+func unretractVersion(c echo.Context) (interface{}, *ErrorResponse) {
+	versionID := c.Param("versionId")
+
+	version := postgres.GetVersion(versionID, util.Context(c))
+	if version == nil {
+		return nil, &ErrorVersionNotFound
+	}
+
+	if err := postgres.UnretractVersion(version, util.Context(c)); err != nil {
+		return nil, &ErrorVersionNotFound
+	}
+
+	return VersionToVersion(version), nil
+}
+
 // @Summary Download a Version
 // @Tags Version
 // @Description Download a mod version by version ID
@@ -52,5 +143,5 @@ func downloadVersion(c echo.Context) error {
 		postgres.IncrementVersionDownloads(version, util.Context(c))
 	}
 
-	return c.Redirect(302, storage.GenerateDownloadLink(version.Key))
+	return c.Redirect(302, resolveDownloadURL(version))
 }